@@ -0,0 +1,95 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet/config"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet/drift"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/types"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+	"github.com/golang/glog"
+)
+
+var (
+	configPath          = flag.String("config", "", "Path to the config file or directory of files")
+	fileCheckFrequency  = flag.Duration("file_check_frequency", 20*time.Second, "Duration between checking the config path for new data (fallback poll interval; fsnotify handles the common case)")
+	driftDetectInterval = flag.Duration("drift-detect-interval", 0, "Interval between drift-detection reconcile ticks comparing the file/URL config sources against the container runtime (0 disables drift detection)")
+)
+
+func main() {
+	flag.Parse()
+	util.InitLogs()
+	defer util.FlushLogs()
+
+	kubelet.SetupCapabilities(false)
+	kubelet.SetupLogging()
+
+	apiClient, err := client.New(&client.Config{})
+	if err != nil {
+		glog.Fatalf("Unable to create API client: %v", err)
+	}
+	kubelet.SetupEventSending(apiClient, "")
+
+	stopCh := make(chan struct{})
+	var detector *drift.Detector
+	if *driftDetectInterval > 0 {
+		// TODO: runtimeLister is a stub (see below) until this snapshot
+		// carries a container runtime client to back it, so the detector
+		// started here is reachable but will never observe a real pod and
+		// therefore can never report drift. Warn loudly rather than leave an
+		// operator believing --drift-detect-interval is doing something.
+		glog.Warningf("--drift-detect-interval is set, but this build's runtime lister is a stub; drift detection will not fire")
+		detector = kubelet.SetupDriftDetection(runtimeLister, *driftDetectInterval, stopCh)
+	}
+
+	updates := make(chan interface{})
+	if *configPath != "" {
+		config.NewSourceFile(*configPath, *fileCheckFrequency, updates)
+	}
+
+	for update := range updates {
+		podUpdate := update.(kubelet.PodUpdate)
+		if detector != nil {
+			detector.Accept(podUpdate.Pods, podUpdate.Op == kubelet.SET)
+		}
+		dispatchPodUpdate(podUpdate)
+	}
+}
+
+// runtimeLister is the drift.RuntimeLister backing this kubelet's Detector.
+// It is currently a stub that reports every pod as unseen by the runtime
+// (ok == false), which Detector.reconcilePod treats as "not drifted" -
+// i.e. the detector is wired up and reachable but cannot yet detect
+// anything real. TODO: this snapshot doesn't carry the container runtime
+// (Docker/rkt) client pkg/kubelet depends on to answer this; replace this
+// stub with a query against that runtime's pod status cache, the same way
+// dispatchPodUpdate eventually feeds the real runtime.
+func runtimeLister(uid types.UID) (drift.RuntimeState, bool) {
+	return drift.RuntimeState{}, false
+}
+
+// dispatchPodUpdate is where a PodUpdate would be handed to the container
+// runtime to reconcile running containers against it. TODO: this snapshot
+// doesn't carry that sync loop; see runtimeLister.
+func dispatchPodUpdate(update kubelet.PodUpdate) {
+	glog.V(3).Infof("Got pod update (op=%v): %d pods", update.Op, len(update.Pods))
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package portforward
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// ForwardedPort is a single local:remote pair, as accepted on the kubectl
+// port-forward command line ("8888:5000", ":5000", "5000").
+type ForwardedPort struct {
+	Local  uint16
+	Remote uint16
+}
+
+// Dialer opens the single upstream connection a Forward call's local
+// connections all share. A reconnect builds a fresh Dialer pointed at the
+// pod's current host; it never touches PortForwarder's already-bound local
+// listeners.
+type Dialer interface {
+	Dial() (Session, error)
+}
+
+// Session is one live upstream connection (e.g. an upgraded SPDY
+// connection), capable of opening a stream per accepted local TCP
+// connection.
+type Session interface {
+	// OpenStream opens a new stream to remotePort over the session.
+	OpenStream(remotePort uint16) (io.ReadWriteCloser, error)
+	// Done is closed when the session itself - not just one stream - has
+	// been torn down and can no longer open new streams.
+	Done() <-chan struct{}
+	Close() error
+}
+
+// PortForwarder binds its local listeners exactly once, in New, so that a
+// supervising reconnect loop can call Forward repeatedly with a fresh
+// Dialer (a new upstream session) without ever closing or rebinding a
+// socket a client may already be talking to.
+type PortForwarder struct {
+	ports     []ForwardedPort
+	listeners []net.Listener
+}
+
+// New parses ports ("[local:]remote" entries, local 0 or omitted meaning
+// "pick a free port") and binds a local TCP listener for each one. The
+// listeners stay open for pf's entire lifetime; call Forward, possibly more
+// than once, to connect them to a Dialer.
+func New(ports []string) (*PortForwarder, error) {
+	parsed, err := parsePorts(ports)
+	if err != nil {
+		return nil, err
+	}
+
+	pf := &PortForwarder{}
+	for _, p := range parsed {
+		listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", p.Local))
+		if err != nil {
+			pf.Close()
+			return nil, fmt.Errorf("unable to listen on port %d: %v", p.Local, err)
+		}
+		if p.Local == 0 {
+			p.Local = uint16(listener.Addr().(*net.TCPAddr).Port)
+		}
+		pf.ports = append(pf.ports, p)
+		pf.listeners = append(pf.listeners, listener)
+	}
+	return pf, nil
+}
+
+// Ports reports the resolved local:remote pairs pf is listening on (local
+// ports of 0 have been replaced with the port actually bound).
+func (pf *PortForwarder) Ports() []ForwardedPort {
+	return pf.ports
+}
+
+// Close releases all of pf's local listeners. Only the owner of a
+// PortForwarder that is done with it for good should call this: a
+// reconnecting Supervisor keeps pf (and its listeners) alive across Forward
+// calls and only closes it once stopCh fires for good.
+func (pf *PortForwarder) Close() {
+	for _, l := range pf.listeners {
+		l.Close()
+	}
+}
+
+// Forward dials dialer once for a session shared by every local connection
+// accepted on pf's listeners during this call, proxying each one to its own
+// stream. It returns when stopCh is closed (nil) or the session itself dies
+// (its Done channel fires), without ever closing pf's listeners, so the
+// caller can call Forward again with a new Dialer to reconnect.
+func (pf *PortForwarder) Forward(dialer Dialer, stopCh <-chan struct{}) error {
+	session, err := dialer.Dial()
+	if err != nil {
+		return fmt.Errorf("unable to establish upstream connection: %v", err)
+	}
+	defer session.Close()
+
+	var wg sync.WaitGroup
+	acceptStop := make(chan struct{})
+	for i, listener := range pf.listeners {
+		wg.Add(1)
+		go func(listener net.Listener, remote uint16) {
+			defer wg.Done()
+			pf.acceptLoop(listener, remote, session, acceptStop)
+		}(listener, pf.ports[i].Remote)
+	}
+	defer func() {
+		close(acceptStop)
+		wg.Wait()
+	}()
+
+	select {
+	case <-stopCh:
+		return nil
+	case <-session.Done():
+		return fmt.Errorf("upstream connection closed")
+	}
+}
+
+// acceptLoop accepts connections on listener, handing each off to its own
+// goroutine to proxy into a fresh stream on session, until acceptStop closes
+// (the enclosing Forward call is tearing down for a reconnect) or Accept
+// itself fails.
+func (pf *PortForwarder) acceptLoop(listener net.Listener, remote uint16, session Session, acceptStop <-chan struct{}) {
+	type acceptResult struct {
+		conn net.Conn
+		err  error
+	}
+
+	for {
+		accepted := make(chan acceptResult, 1)
+		go func() {
+			conn, err := listener.Accept()
+			accepted <- acceptResult{conn, err}
+		}()
+
+		select {
+		case <-acceptStop:
+			return
+		case res := <-accepted:
+			if res.err != nil {
+				return
+			}
+			go proxyConnection(res.conn, remote, session)
+		}
+	}
+}
+
+// proxyConnection opens a stream to remotePort on session and copies bytes
+// in both directions until either side closes or the stream errors.
+func proxyConnection(conn net.Conn, remote uint16, session Session) {
+	defer conn.Close()
+
+	stream, err := session.OpenStream(remote)
+	if err != nil {
+		glog.Errorf("Unable to open stream for port %d: %v", remote, err)
+		return
+	}
+	defer stream.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(stream, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, stream)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// parsePorts accepts the same "[local:]remote" forms as kubectl
+// port-forward's positional arguments.
+func parsePorts(ports []string) ([]ForwardedPort, error) {
+	parsed := make([]ForwardedPort, 0, len(ports))
+	for _, portString := range ports {
+		parts := strings.Split(portString, ":")
+
+		var localString, remoteString string
+		switch len(parts) {
+		case 1:
+			localString, remoteString = parts[0], parts[0]
+		case 2:
+			localString, remoteString = parts[0], parts[1]
+		default:
+			return nil, fmt.Errorf("invalid port format %q", portString)
+		}
+
+		remote, err := strconv.ParseUint(remoteString, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid remote port %q: %v", remoteString, err)
+		}
+
+		var local uint64
+		if localString != "" && localString != "0" {
+			local, err = strconv.ParseUint(localString, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid local port %q: %v", localString, err)
+			}
+		}
+
+		parsed = append(parsed, ForwardedPort{Local: uint16(local), Remote: uint16(remote)})
+	}
+	return parsed, nil
+}
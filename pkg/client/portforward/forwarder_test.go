@@ -0,0 +1,152 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package portforward
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeSession is a stand-in for an upgraded SPDY connection: OpenStream
+// hands back an in-memory pipe, and closing done simulates the whole
+// session (not just one stream) dying mid-flight, as a dropped SPDY server
+// would.
+type fakeSession struct {
+	done   chan struct{}
+	closed bool
+}
+
+func newFakeSession() *fakeSession {
+	return &fakeSession{done: make(chan struct{})}
+}
+
+func (s *fakeSession) OpenStream(remotePort uint16) (io.ReadWriteCloser, error) {
+	server, client := net.Pipe()
+	go func() {
+		buf := make([]byte, 1024)
+		n, err := server.Read(buf)
+		if err == nil {
+			server.Write(buf[:n])
+		}
+		server.Close()
+	}()
+	return client, nil
+}
+
+func (s *fakeSession) Done() <-chan struct{} { return s.done }
+
+func (s *fakeSession) Close() error {
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	return nil
+}
+
+// fakeDialer is a fake SPDY server dialer: it returns sessions in order,
+// one per call to Dial, so a test can make the first session drop mid-
+// session and the next one stay up.
+type fakeDialer struct {
+	sessions []*fakeSession
+	dialed   int
+}
+
+func (d *fakeDialer) Dial() (Session, error) {
+	if d.dialed >= len(d.sessions) {
+		return nil, fmt.Errorf("fakeDialer: no more sessions configured")
+	}
+	s := d.sessions[d.dialed]
+	d.dialed++
+	return s, nil
+}
+
+// TestForwardReconnectsAfterDroppedSessionWithoutRebindingListener models a
+// fake SPDY server that drops the stream mid-session: the first Forward
+// call's session is torn down out from under it, Forward must return an
+// error (what a Supervisor treats as "reconnect"), and a second Forward call
+// against the very same PortForwarder must keep serving the identical local
+// listener rather than closing and rebinding it.
+func TestForwardReconnectsAfterDroppedSessionWithoutRebindingListener(t *testing.T) {
+	pf, err := New([]string{"0:8080"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer pf.Close()
+
+	localAddr := pf.Ports()[0].Local
+	if localAddr == 0 {
+		t.Fatalf("Expected a local port to be bound")
+	}
+
+	dropped := newFakeSession()
+	stopCh := make(chan struct{})
+
+	forwardDone := make(chan error, 1)
+	go func() { forwardDone <- pf.Forward(&fakeDialer{sessions: []*fakeSession{dropped}}, stopCh) }()
+
+	// Give the accept loop a moment to start, then drop the session, as a
+	// SPDY server disconnecting mid-session would.
+	time.Sleep(50 * time.Millisecond)
+	dropped.Close()
+
+	select {
+	case err := <-forwardDone:
+		if err == nil {
+			t.Fatalf("Expected Forward to report an error when the session drops")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Forward to return after the session dropped")
+	}
+
+	// The listener must still be bound to the same address: a client that
+	// tries to connect during the reconnect window gets queued/refused by
+	// the kernel only if nothing is listening at all, and here something
+	// always is.
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", localAddr), time.Second)
+	if err != nil {
+		t.Fatalf("Expected listener to remain bound across reconnect, got: %v", err)
+	}
+	conn.Close()
+
+	// Reconnect with a healthy session and confirm traffic flows again
+	// through the very same PortForwarder/listener.
+	healthy := newFakeSession()
+	forwardDone = make(chan error, 1)
+	go func() { forwardDone <- pf.Forward(&fakeDialer{sessions: []*fakeSession{healthy}}, stopCh) }()
+	defer close(stopCh)
+
+	conn, err = net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", localAddr), time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error reconnecting: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("Unexpected error writing: %v", err)
+	}
+	buf := make([]byte, 4)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("Unexpected error reading echoed data through reconnected session: %v", err)
+	}
+	if string(buf) != "ping" {
+		t.Fatalf("Expected echoed %q, got %q", "ping", buf)
+	}
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package portforward
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util/httpstream"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util/httpstream/spdy"
+	"github.com/golang/glog"
+)
+
+// minHealthyRun is how long a Forward call must stay up before its reconnect
+// is considered a fresh start rather than a continuation of the same
+// failure streak: see the comment on attempt in Run.
+const minHealthyRun = 1 * time.Minute
+
+// portForwardProtocolV1Name is the SPDY subprotocol negotiated with the
+// kubelet's portForward endpoint, matching the server side.
+const portForwardProtocolV1Name = "portforward.k8s.io"
+
+// RetryConfig controls how a Supervisor reconnects a port-forward session
+// after a stream error: MaxRetries caps the number of consecutive reconnect
+// attempts (0 means unlimited; the count starts over after a session stays
+// up for minHealthyRun), and the delay between attempts backs off
+// exponentially, jittered, up to MaxBackoff.
+type RetryConfig struct {
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryConfig is used by kubectl port-forward when the user doesn't
+// override --retry/--retry-backoff.
+var DefaultRetryConfig = RetryConfig{
+	MaxRetries: 0,
+	Backoff:    time.Second,
+	MaxBackoff: 30 * time.Second,
+}
+
+// Supervisor keeps a port-forward tunnel alive across transient SPDY/TCP
+// errors and pod reschedules: on stream error it re-resolves the pod (to
+// pick up a new Status.Host), waits for it to be running again, and re-dials
+// while keeping the same local listeners bound, via a single PortForwarder
+// shared across attempts, so client TCP connections see only a brief stall
+// rather than connection refused.
+type Supervisor struct {
+	Client       *client.Client
+	ClientConfig *client.Config
+	Namespace    string
+	Pod          string
+	Ports        []string
+	Retry        RetryConfig
+
+	// newDialer builds the Dialer used for one attempt. When nil, Run uses a
+	// restClientDialer, which upgrades to a real SPDY connection.
+	newDialer func(req *client.Request, config *client.Config) Dialer
+}
+
+// Run binds pf's local listeners once, then supervises the forwarding
+// session until stopCh is closed or retries are exhausted, redialing
+// upstream on stream errors without ever closing pf's listeners. It returns
+// the error from the final failed attempt, or nil if stopCh was closed
+// cleanly. A failure to look up the pod is returned at once, without a
+// retry.
+func (s *Supervisor) Run(stopCh <-chan struct{}) error {
+	pf, err := New(s.Ports)
+	if err != nil {
+		return err
+	}
+	defer pf.Close()
+
+	newDialer := s.newDialer
+	if newDialer == nil {
+		newDialer = func(req *client.Request, config *client.Config) Dialer {
+			return &restClientDialer{req: req, config: config}
+		}
+	}
+
+	attempt := 0
+	for {
+		pod, err := s.Client.Pods(s.Namespace).Get(s.Pod)
+		if err != nil {
+			return fmt.Errorf("unable to resolve pod %s/%s: %v", s.Namespace, s.Pod, err)
+		}
+
+		if pod.Status.Phase != api.PodRunning {
+			if !s.waitForRunning(stopCh) {
+				return nil
+			}
+			continue
+		}
+
+		req := s.Client.RESTClient.Get().
+			Prefix("proxy").
+			Resource("minions").
+			Name(pod.Status.Host).
+			Suffix("portForward", s.Namespace, s.Pod)
+
+		glog.V(2).Infof("Forwarding to pod %s/%s on %s (attempt %d)", s.Namespace, s.Pod, pod.Status.Host, attempt)
+		started := time.Now()
+		err = pf.Forward(newDialer(req, s.ClientConfig), stopCh)
+
+		select {
+		case <-stopCh:
+			return nil
+		default:
+		}
+
+		if err == nil {
+			return nil
+		}
+
+		// A session that stayed up a while before dropping isn't part of the
+		// same failure streak as one that dies immediately on reconnect;
+		// count only consecutive quick failures against MaxRetries, or a
+		// long-lived tunnel that merely blips occasionally would eventually
+		// hit the cap and give up for good.
+		if time.Since(started) >= minHealthyRun {
+			attempt = 0
+		}
+
+		attempt++
+		if s.Retry.MaxRetries > 0 && attempt > s.Retry.MaxRetries {
+			return fmt.Errorf("port-forward to %s/%s failed after %d retries: %v", s.Namespace, s.Pod, s.Retry.MaxRetries, err)
+		}
+
+		glog.Errorf("Lost port-forward to pod %s/%s: %v, reconnecting", s.Namespace, s.Pod, err)
+		if !s.sleep(s.backoff(attempt), stopCh) {
+			return nil
+		}
+	}
+}
+
+// waitForRunning blocks (polling) until the pod becomes running (returns
+// true) or stopCh is closed (returns false). An error looking up the pod is
+// logged and polling continues.
+func (s *Supervisor) waitForRunning(stopCh <-chan struct{}) bool {
+	for {
+		if !s.sleep(time.Second, stopCh) {
+			return false
+		}
+		pod, err := s.Client.Pods(s.Namespace).Get(s.Pod)
+		if err != nil {
+			glog.Errorf("Unable to resolve pod %s/%s while waiting for it to run: %v", s.Namespace, s.Pod, err)
+			continue
+		}
+		if pod.Status.Phase == api.PodRunning {
+			return true
+		}
+	}
+}
+
+// backoff computes the exponential, jittered delay before reconnect attempt.
+func (s *Supervisor) backoff(attempt int) time.Duration {
+	base := s.Retry.Backoff
+	if base <= 0 {
+		base = DefaultRetryConfig.Backoff
+	}
+	max := s.Retry.MaxBackoff
+	if max <= 0 {
+		max = DefaultRetryConfig.MaxBackoff
+	}
+
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay) / 2))
+	return delay/2 + jitter
+}
+
+// sleep waits for d or until stopCh is closed, whichever comes first. It
+// returns false if stopCh fired.
+func (s *Supervisor) sleep(d time.Duration, stopCh <-chan struct{}) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-stopCh:
+		return false
+	}
+}
+
+// restClientDialer is the production Dialer: Dial upgrades req to a single
+// streaming SPDY connection that every accepted local connection opens its
+// own stream on, the same upgrade the pre-Supervisor single-shot
+// portforward.New/ForwardPorts performed inline.
+type restClientDialer struct {
+	req    *client.Request
+	config *client.Config
+}
+
+func (d *restClientDialer) Dial() (Session, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(d.config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create SPDY round tripper: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", d.req.URL().String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add(httpstream.HeaderProtocolVersion, portForwardProtocolV1Name)
+
+	httpClient := &http.Client{Transport: transport}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to upgrade connection to %s: %v", d.req.URL(), err)
+	}
+	defer resp.Body.Close()
+
+	conn, err := upgrader.NewConnection(resp)
+	if err != nil {
+		return nil, fmt.Errorf("unable to upgrade connection to %s: %v", d.req.URL(), err)
+	}
+
+	return &spdySession{conn: conn}, nil
+}
+
+// spdySession adapts an upgraded httpstream.Connection to the Dialer/Session
+// split Forward uses: every accepted local connection opens its own data
+// stream over the one shared connection.
+type spdySession struct {
+	conn httpstream.Connection
+}
+
+func (s *spdySession) OpenStream(remotePort uint16) (io.ReadWriteCloser, error) {
+	headers := http.Header{}
+	headers.Set("streamType", "data")
+	headers.Set("port", strconv.Itoa(int(remotePort)))
+	return s.conn.CreateStream(headers)
+}
+
+func (s *spdySession) Done() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		<-s.conn.CloseChan()
+		close(done)
+	}()
+	return done
+}
+
+func (s *spdySession) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,38 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package portforward
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDoublesUpToCeiling(t *testing.T) {
+	s := &Supervisor{
+		Retry: RetryConfig{
+			Backoff:    time.Second,
+			MaxBackoff: 10 * time.Second,
+		},
+	}
+
+	if got := s.backoff(1); got > time.Second {
+		t.Errorf("attempt 1: expected at most %v, got %v", time.Second, got)
+	}
+	if got := s.backoff(10); got > 10*time.Second {
+		t.Errorf("attempt 10: expected backoff capped at %v, got %v", 10*time.Second, got)
+	}
+}
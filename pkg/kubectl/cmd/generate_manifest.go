@@ -0,0 +1,112 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api/v1beta1"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api/v1beta2"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubectl/cmd/util"
+	"github.com/spf13/cobra"
+)
+
+const (
+	generatemanifest_example = `$ kubectl generate-manifest -p mypod > mypod-manifest.json
+<writes a standalone v1beta1 ContainerManifest for mypod to mypod-manifest.json,
+ suitable for use with a kubelet's --config directory>
+
+$ kubectl generate-manifest -p mypod --version v1beta2
+<same, but emits the v1beta2 ContainerManifest shape>`
+)
+
+// NewCmdGenerateManifest emits a standalone ContainerManifest for a running
+// pod: the inverse of the config.sourceFile loader, for snapshotting a
+// cluster-scheduled pod into a static manifest for standalone-kubelet or
+// air-gapped use.
+func (f *Factory) NewCmdGenerateManifest(out io.Writer) *cobra.Command {
+	flags := &struct {
+		pod     string
+		version string
+	}{}
+
+	cmd := &cobra.Command{
+		Use:     "generate-manifest -p <pod>",
+		Short:   "Generate a ContainerManifest for a running pod.",
+		Long:    "Generate a ContainerManifest for a running pod, suitable for a kubelet's --config directory.",
+		Example: generatemanifest_example,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(flags.pod) == 0 {
+				usageError(cmd, "<pod> is required for generate-manifest")
+			}
+
+			namespace, err := f.DefaultNamespace(cmd)
+			util.CheckErr(err)
+
+			client, err := f.Client(cmd)
+			util.CheckErr(err)
+
+			pod, err := client.Pods(namespace).Get(flags.pod)
+			util.CheckErr(err)
+
+			data, err := podToManifestBytes(pod, flags.version)
+			util.CheckErr(err)
+
+			fmt.Fprintln(out, string(data))
+		},
+	}
+	cmd.Flags().StringVarP(&flags.pod, "pod", "p", "", "Pod name")
+	cmd.Flags().StringVar(&flags.version, "version", "v1beta1", "API version of the generated manifest: v1beta1 or v1beta2")
+	return cmd
+}
+
+// podToManifestBytes converts pod to a standalone ContainerManifest in the
+// requested version, stripping the cluster-only fields (Status, SelfLink,
+// ResourceVersion, the scheduler-assigned host, and the generated name)
+// that don't make sense outside of the cluster the pod was scheduled in.
+func podToManifestBytes(pod *api.Pod, version string) ([]byte, error) {
+	boundPod := api.BoundPod{
+		ObjectMeta: pod.ObjectMeta,
+		Spec:       pod.Spec,
+	}
+	boundPod.SelfLink = ""
+	boundPod.ResourceVersion = ""
+	boundPod.GenerateName = ""
+
+	var out interface{}
+	switch version {
+	case "v1beta1":
+		manifest := &v1beta1.ContainerManifest{}
+		if err := api.Scheme.Convert(&boundPod, manifest); err != nil {
+			return nil, err
+		}
+		out = manifest
+	case "v1beta2":
+		manifest := &v1beta2.ContainerManifest{}
+		if err := api.Scheme.Convert(&boundPod, manifest); err != nil {
+			return nil, err
+		}
+		out = manifest
+	default:
+		return nil, fmt.Errorf("unsupported manifest version %q", version)
+	}
+
+	return json.MarshalIndent(out, "", "  ")
+}
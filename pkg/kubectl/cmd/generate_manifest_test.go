@@ -0,0 +1,83 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet/config"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/types"
+)
+
+// TestPodToManifestBytesRoundTripsThroughFileSource checks that a manifest
+// generated from a running pod is exactly what config.NewSourceFile (the
+// loader it's meant to feed) can read back in.
+func TestPodToManifestBytesRoundTripsThroughFileSource(t *testing.T) {
+	pod := &api.Pod{
+		ObjectMeta: api.ObjectMeta{
+			Name:      "generated",
+			UID:       types.UID("12345"),
+			Namespace: "default",
+			SelfLink:  "/api/v1beta1/pods/generated",
+		},
+		Spec: api.PodSpec{
+			Containers: []api.Container{{Name: "c1", Image: "test/image"}},
+		},
+		Status: api.PodStatus{
+			Phase: api.PodRunning,
+			Host:  "10.0.0.1",
+		},
+	}
+
+	data, err := podToManifestBytes(pod, "v1beta1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	file, err := ioutil.TempFile(os.TempDir(), "generated_manifest")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.Remove(file.Name())
+	if err := ioutil.WriteFile(file.Name(), data, 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ch := make(chan interface{})
+	config.NewSourceFile(file.Name(), time.Millisecond, ch)
+	select {
+	case got := <-ch:
+		update := got.(kubelet.PodUpdate)
+		if len(update.Pods) != 1 {
+			t.Fatalf("Expected 1 pod from generated manifest, got %d", len(update.Pods))
+		}
+		if update.Pods[0].UID != types.UID("12345") {
+			t.Errorf("Expected UID to survive the round trip, got %q", update.Pods[0].UID)
+		}
+		if len(update.Pods[0].Spec.Containers) != 1 || update.Pods[0].Spec.Containers[0].Image != "test/image" {
+			t.Errorf("Unexpected containers: %#v", update.Pods[0].Spec.Containers)
+		}
+
+	case <-time.After(time.Second):
+		t.Fatalf("Expected update, timeout instead")
+	}
+}
@@ -19,6 +19,7 @@ package cmd
 import (
 	"os"
 	"os/signal"
+	"time"
 
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/client/portforward"
@@ -43,8 +44,10 @@ $ kubectl port-forward -p mypod 0:5000
 
 func (f *Factory) NewCmdPortForward() *cobra.Command {
 	flags := &struct {
-		pod       string
-		container string
+		pod          string
+		container    string
+		retry        int
+		retryBackoff time.Duration
 	}{}
 
 	cmd := &cobra.Command{
@@ -87,20 +90,24 @@ func (f *Factory) NewCmdPortForward() *cobra.Command {
 				close(stopCh)
 			}()
 
-			req := client.RESTClient.Get().
-				Prefix("proxy").
-				Resource("minions").
-				Name(pod.Status.Host).
-				Suffix("portForward", namespace, flags.pod)
-
-			pf, err := portforward.New(req, config, args, stopCh)
-			util.CheckErr(err)
-
-			err = pf.ForwardPorts()
-			util.CheckErr(err)
+			supervisor := &portforward.Supervisor{
+				Client:       client,
+				ClientConfig: config,
+				Namespace:    namespace,
+				Pod:          flags.pod,
+				Ports:        args,
+				Retry: portforward.RetryConfig{
+					MaxRetries: flags.retry,
+					Backoff:    flags.retryBackoff,
+					MaxBackoff: portforward.DefaultRetryConfig.MaxBackoff,
+				},
+			}
+			util.CheckErr(supervisor.Run(stopCh))
 		},
 	}
 	cmd.Flags().StringVarP(&flags.pod, "pod", "p", "", "Pod name")
 	// TODO support UID
+	cmd.Flags().IntVar(&flags.retry, "retry", 0, "Number of consecutive times to retry the tunnel after a stream error; the count starts over after the tunnel stays up for a minute (0 means retry forever)")
+	cmd.Flags().DurationVar(&flags.retryBackoff, "retry-backoff", time.Second, "Initial backoff between reconnect attempts; doubles up to a 30s ceiling")
 	return cmd
 }
@@ -0,0 +1,336 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api/v1beta1"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/types"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+	"github.com/fsnotify/fsnotify"
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+)
+
+// fileWatchDebounce coalesces bursts of filesystem events (e.g. a multi-file
+// "cp" into the manifest directory, or an editor's write-then-rename) into a
+// single reload.
+const fileWatchDebounce = 100 * time.Millisecond
+
+type sourceFile struct {
+	path    string
+	updates chan<- interface{}
+}
+
+// NewSourceFile watches path (a single manifest file, or a directory of
+// them) and sends a SET kubelet.PodUpdate on updates whenever the contents
+// of path change. Changes are detected with fsnotify and debounced; period
+// is kept as a fallback poll interval for filesystems that don't deliver
+// notifications (NFS, some FUSE mounts) and as a safety net for events the
+// watcher missed. A single file may declare more than one pod: a JSON
+// array, or a "---"-separated stream of YAML documents, are both flattened
+// into the update's Pods slice.
+func NewSourceFile(path string, period time.Duration, updates chan<- interface{}) {
+	config := &sourceFile{
+		path:    path,
+		updates: updates,
+	}
+	glog.Infof("Watching path %q", path)
+	go config.run(period)
+}
+
+// run reloads path once up front, then blocks reloading again whenever
+// fsnotify reports a change (debounced) or period elapses, whichever comes
+// first. It never returns; callers run it in a goroutine.
+func (s *sourceFile) run(period time.Duration) {
+	if err := s.extractFromPath(); err != nil {
+		glog.Errorf("Unable to read config path %q: %v", s.path, err)
+	}
+
+	watcher, err := s.newWatcher()
+	if err != nil {
+		glog.Errorf("Unable to watch config path %q, falling back to polling every %v: %v", s.path, period, err)
+		util.Forever(func() {
+			if err := s.extractFromPath(); err != nil {
+				glog.Errorf("Unable to read config path %q: %v", s.path, err)
+			}
+		}, period)
+		return
+	}
+	defer watcher.Close()
+
+	var debounce <-chan time.Time
+	poll := time.NewTicker(period)
+	defer poll.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) == 0 {
+				continue
+			}
+			debounce = time.After(fileWatchDebounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			glog.Errorf("Watch error on config path %q: %v", s.path, err)
+
+		case <-debounce:
+			debounce = nil
+			if err := s.extractFromPath(); err != nil {
+				glog.Errorf("Unable to read config path %q: %v", s.path, err)
+			}
+
+		case <-poll.C:
+			if err := s.extractFromPath(); err != nil {
+				glog.Errorf("Unable to read config path %q: %v", s.path, err)
+			}
+		}
+	}
+}
+
+// newWatcher starts watching s.path for changes. If s.path is a single file
+// rather than a directory, the containing directory is watched instead so
+// that atomic rename-replace (the usual way editors and `cp` update a file
+// in place) is still observed.
+func (s *sourceFile) newWatcher() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	watchPath := s.path
+	if statInfo, err := os.Stat(s.path); err == nil && !statInfo.IsDir() {
+		watchPath = filepath.Dir(s.path)
+	}
+	if err := watcher.Add(watchPath); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return watcher, nil
+}
+
+func (s *sourceFile) extractFromPath() error {
+	statInfo, err := os.Stat(s.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		// Emit an update with an empty PodUpdate so that the file source is
+		// marked as seen even though the path doesn't (yet) exist.
+		s.updates <- CreatePodUpdate(kubelet.SET, kubelet.FileSource)
+		return fmt.Errorf("path %q does not exist", s.path)
+	}
+
+	switch {
+	case statInfo.Mode().IsDir():
+		pods, err := extractFromDir(s.path)
+		if err != nil {
+			return err
+		}
+		s.updates <- CreatePodUpdate(kubelet.SET, kubelet.FileSource, pods...)
+
+	case statInfo.Mode().IsRegular():
+		pods, err := extractFromFile(s.path)
+		if err != nil {
+			return err
+		}
+		s.updates <- CreatePodUpdate(kubelet.SET, kubelet.FileSource, pods...)
+
+	default:
+		return fmt.Errorf("path %q is not a directory or file", s.path)
+	}
+
+	return nil
+}
+
+// extractFromDir reads every file directly inside name (sub-directories are
+// not recursed into) and merges the pods they declare into a single slice.
+func extractFromDir(name string) ([]api.BoundPod, error) {
+	dirents, err := filepath.Glob(filepath.Join(name, "[^.]*"))
+	if err != nil {
+		return nil, fmt.Errorf("glob failed: %v", err)
+	}
+
+	pods := make([]api.BoundPod, 0)
+	if len(dirents) == 0 {
+		return pods, nil
+	}
+
+	sort.Strings(dirents)
+	for _, path := range dirents {
+		statInfo, err := os.Stat(path)
+		if err != nil {
+			glog.Errorf("Can't get metadata for %q: %v", path, err)
+			continue
+		}
+
+		switch {
+		case statInfo.Mode().IsDir():
+			glog.Errorf("Not recursing into manifest path %q", path)
+		case statInfo.Mode().IsRegular():
+			filePods, err := extractFromFile(path)
+			if err != nil {
+				glog.Errorf("Can't process manifest file %q: %v", path, err)
+			} else {
+				pods = append(pods, filePods...)
+			}
+		default:
+			glog.Errorf("Config path %q is not a directory or file: %v", path, statInfo.Mode())
+		}
+	}
+	return pods, nil
+}
+
+// extractFromFile decodes every ContainerManifest document declared in
+// filename and returns the BoundPods they convert to. The file may be a
+// single JSON or YAML object, a JSON array of objects, or a stream of YAML
+// documents separated by "---" lines; documents may mix the v1beta1 and
+// v1beta2 API versions.
+func extractFromFile(filename string) ([]api.BoundPod, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := splitIntoDocuments(data)
+	if err != nil {
+		return nil, fmt.Errorf("can't read manifests from %q: %v", filename, err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	hostname = strings.ToLower(hostname)
+
+	pods := make([]api.BoundPod, 0, len(docs))
+	for i, doc := range docs {
+		pod, err := decodeManifest(doc)
+		if err != nil {
+			return nil, fmt.Errorf("can't unmarshal manifest %d of %q: %v", i, filename, err)
+		}
+		if len(pod.UID) == 0 {
+			pod.UID = hashForManifest(filename, i, &pod)
+		}
+		if len(pod.Name) == 0 {
+			pod.Name = string(pod.UID)
+		}
+		pod.Name = fmt.Sprintf("%s-%s", pod.Name, hostname)
+		pod.Namespace = kubelet.NamespaceDefault
+		pod.SelfLink = fmt.Sprintf("/api/v1beta2/pods/%s?namespace=%s", pod.Name, pod.Namespace)
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// splitIntoDocuments breaks data into the individual manifest documents it
+// declares: a JSON array is split into its elements, a "---"-separated YAML
+// stream is split on the separator, and anything else is a single document.
+// Empty or whitespace-only data is an error rather than zero documents, so a
+// file caught mid-write (e.g. a fsnotify CREATE racing the writer) is
+// retried like any other malformed manifest instead of silently dropping
+// every pod it was going to declare.
+func splitIntoDocuments(data []byte) ([][]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("manifest is empty")
+	}
+
+	if trimmed[0] == '[' {
+		var raw []json.RawMessage
+		if err := json.Unmarshal(trimmed, &raw); err != nil {
+			return nil, err
+		}
+		docs := make([][]byte, len(raw))
+		for i := range raw {
+			docs[i] = []byte(raw[i])
+		}
+		return docs, nil
+	}
+
+	docs := make([][]byte, 0, 1)
+	var current bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "---" {
+			if doc := bytes.TrimSpace(current.Bytes()); len(doc) > 0 {
+				docs = append(docs, append([]byte(nil), doc...))
+			}
+			current.Reset()
+			continue
+		}
+		current.WriteString(scanner.Text())
+		current.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if doc := bytes.TrimSpace(current.Bytes()); len(doc) > 0 {
+		docs = append(docs, append([]byte(nil), doc...))
+	}
+	return docs, nil
+}
+
+// decodeManifest decodes a single ContainerManifest document, JSON or YAML,
+// v1beta1 or v1beta2, through the versioned API codec and converts it to an
+// api.BoundPod the same way a single-document manifest always has.
+func decodeManifest(doc []byte) (api.BoundPod, error) {
+	var pod api.BoundPod
+	var manifest v1beta1.ContainerManifest
+
+	asJSON, err := yaml.YAMLToJSON(doc)
+	if err != nil {
+		return pod, err
+	}
+	if err := api.Scheme.DecodeInto(asJSON, &manifest); err != nil {
+		return pod, err
+	}
+	if err := api.Scheme.Convert(&manifest, &pod); err != nil {
+		return pod, err
+	}
+	return pod, nil
+}
+
+// hashForManifest produces a stable UID for a manifest document that didn't
+// specify one of its own, derived from where it came from so that re-reads
+// of an unchanged file don't churn pod identity.
+func hashForManifest(source string, index int, pod *api.BoundPod) types.UID {
+	hasher := md5.New()
+	fmt.Fprintf(hasher, "file:%s", source)
+	fmt.Fprintf(hasher, "index:%d", index)
+	util.DeepHashObject(hasher, pod)
+	return types.UID(hex.EncodeToString(hasher.Sum(nil)))
+}
@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
@@ -30,6 +31,7 @@ import (
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api/validation"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/types"
+	"github.com/ghodss/yaml"
 )
 
 func ExampleManifestAndPod(id string) (v1beta1.ContainerManifest, api.BoundPod) {
@@ -78,6 +80,14 @@ func ExampleManifestAndPod(id string) (v1beta1.ContainerManifest, api.BoundPod)
 	return manifest, expectedPod
 }
 
+// sortedPods lets tests sort.Sort a PodUpdate's pods by UID before comparing
+// them, since extractFromDir orders pods by file name rather than by UID.
+type sortedPods []api.BoundPod
+
+func (s sortedPods) Len() int           { return len(s) }
+func (s sortedPods) Less(i, j int) bool { return s[i].UID < s[j].UID }
+func (s sortedPods) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
 func TestExtractFromNonExistentFile(t *testing.T) {
 	ch := make(chan interface{}, 1)
 	c := sourceFile{"/some/fake/file", ch}
@@ -264,6 +274,155 @@ func TestReadFromFileWithDefaults(t *testing.T) {
 	}
 }
 
+func TestReadFromFileWithYAML(t *testing.T) {
+	file := writeTestFile(t, os.TempDir(), "test_pod_config",
+		`version: v1beta1
+uuid: "12345"
+id: test
+containers:
+  - image: test/image
+    imagePullPolicy: PullAlways
+`)
+	defer os.Remove(file.Name())
+
+	ch := make(chan interface{})
+	NewSourceFile(file.Name(), time.Millisecond, ch)
+	select {
+	case got := <-ch:
+		update := got.(kubelet.PodUpdate)
+		expected := CreatePodUpdate(kubelet.SET, kubelet.FileSource, api.BoundPod{
+			ObjectMeta: api.ObjectMeta{
+				Name:      "",
+				UID:       "12345",
+				Namespace: kubelet.NamespaceDefault,
+			},
+			Spec: api.PodSpec{Containers: []api.Container{{Image: "test/image"}}},
+		})
+
+		update.Pods[0].Name = ""
+		update.Pods[0].SelfLink = ""
+		if !api.Semantic.DeepDerivative(expected, update) {
+			t.Fatalf("Expected %#v, Got %#v", expected, update)
+		}
+
+	case <-time.After(time.Second):
+		t.Errorf("Expected update, timeout instead")
+	}
+}
+
+func TestReadFromFileWithJSONArray(t *testing.T) {
+	manifest, expectedPod := ExampleManifestAndPod("1")
+	manifest2, expectedPod2 := ExampleManifestAndPod("2")
+
+	data, err := json.Marshal([]v1beta1.ContainerManifest{manifest, manifest2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	file := writeTestFile(t, os.TempDir(), "test_pod_config", string(data))
+	defer os.Remove(file.Name())
+
+	ch := make(chan interface{}, 1)
+	c := sourceFile{file.Name(), ch}
+	if err := c.extractFromPath(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	update := (<-ch).(kubelet.PodUpdate)
+	for i := range update.Pods {
+		update.Pods[i].Name = ""
+		update.Pods[i].SelfLink = ""
+	}
+	expected := CreatePodUpdate(kubelet.SET, kubelet.FileSource, expectedPod, expectedPod2)
+	sort.Sort(sortedPods(update.Pods))
+	sort.Sort(sortedPods(expected.Pods))
+	if !api.Semantic.DeepDerivative(expected, update) {
+		t.Fatalf("Expected %#v, Got %#v", expected, update)
+	}
+}
+
+func TestReadFromFileWithYAMLStream(t *testing.T) {
+	manifest, expectedPod := ExampleManifestAndPod("1")
+	manifest2, expectedPod2 := ExampleManifestAndPod("2")
+
+	data1, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data2, err := json.Marshal(manifest2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	file := writeTestFile(t, os.TempDir(), "test_pod_config",
+		string(data1)+"\n---\n"+string(data2)+"\n")
+	defer os.Remove(file.Name())
+
+	ch := make(chan interface{}, 1)
+	c := sourceFile{file.Name(), ch}
+	if err := c.extractFromPath(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	update := (<-ch).(kubelet.PodUpdate)
+	for i := range update.Pods {
+		update.Pods[i].Name = ""
+		update.Pods[i].SelfLink = ""
+	}
+	expected := CreatePodUpdate(kubelet.SET, kubelet.FileSource, expectedPod, expectedPod2)
+	sort.Sort(sortedPods(update.Pods))
+	sort.Sort(sortedPods(expected.Pods))
+	if !api.Semantic.DeepDerivative(expected, update) {
+		t.Fatalf("Expected %#v, Got %#v", expected, update)
+	}
+}
+
+func TestExtractFromDirWithMixedFormats(t *testing.T) {
+	manifest, expectedPod := ExampleManifestAndPod("1")
+	manifest2, expectedPod2 := ExampleManifestAndPod("2")
+
+	dirName, err := ioutil.TempDir("", "foo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dirName)
+
+	jsonData, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dirName, "pod1.json"), jsonData, 0755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	yamlData, err := yaml.JSONToYAML(func() []byte {
+		data, _ := json.Marshal(manifest2)
+		return data
+	}())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dirName, "pod2.yaml"), yamlData, 0755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ch := make(chan interface{}, 1)
+	c := sourceFile{dirName, ch}
+	if err := c.extractFromPath(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	update := (<-ch).(kubelet.PodUpdate)
+	for i := range update.Pods {
+		update.Pods[i].Name = ""
+		update.Pods[i].SelfLink = ""
+	}
+	expected := CreatePodUpdate(kubelet.SET, kubelet.FileSource, expectedPod, expectedPod2)
+	sort.Sort(sortedPods(update.Pods))
+	sort.Sort(sortedPods(expected.Pods))
+	if !api.Semantic.DeepDerivative(expected, update) {
+		t.Fatalf("Expected %#v, Got %#v", expected, update)
+	}
+}
+
 func TestExtractFromBadDataFile(t *testing.T) {
 	file := writeTestFile(t, os.TempDir(), "test_pod_config", string([]byte{1, 2, 3}))
 	defer os.Remove(file.Name())
@@ -277,6 +436,19 @@ func TestExtractFromBadDataFile(t *testing.T) {
 	expectEmptyChannel(t, ch)
 }
 
+func TestExtractFromEmptyFile(t *testing.T) {
+	file := writeTestFile(t, os.TempDir(), "test_pod_config", "")
+	defer os.Remove(file.Name())
+
+	ch := make(chan interface{}, 1)
+	c := sourceFile{file.Name(), ch}
+	err := c.extractFromPath()
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+	expectEmptyChannel(t, ch)
+}
+
 func TestExtractFromEmptyDir(t *testing.T) {
 	dirName, err := ioutil.TempDir("", "foo")
 	if err != nil {
@@ -362,3 +534,149 @@ func TestExtractFromDir(t *testing.T) {
 		}
 	}
 }
+
+// waitForUpdate reads the next update off ch, failing the test if none
+// arrives within the timeout. The long fallback poll period used by these
+// tests means a received update can only be explained by the watcher.
+func waitForUpdate(t *testing.T, ch chan interface{}) kubelet.PodUpdate {
+	select {
+	case got := <-ch:
+		return got.(kubelet.PodUpdate)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected update, timeout instead")
+		return kubelet.PodUpdate{}
+	}
+}
+
+func TestWatchCreatesNewManifestFile(t *testing.T) {
+	dirName, err := ioutil.TempDir("", "foo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dirName)
+
+	ch := make(chan interface{}, 2)
+	NewSourceFile(dirName, time.Hour, ch)
+	waitForUpdate(t, ch) // initial SET for the empty directory
+
+	manifest, _ := ExampleManifestAndPod("1")
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dirName, "pod1.json"), data, 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	update := waitForUpdate(t, ch)
+	if len(update.Pods) != 1 {
+		t.Fatalf("Expected 1 pod after create, got %d", len(update.Pods))
+	}
+}
+
+func TestWatchEditsManifestFileInPlace(t *testing.T) {
+	dirName, err := ioutil.TempDir("", "foo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dirName)
+
+	manifest, _ := ExampleManifestAndPod("1")
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	path := filepath.Join(dirName, "pod1.json")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ch := make(chan interface{}, 2)
+	NewSourceFile(dirName, time.Hour, ch)
+	waitForUpdate(t, ch) // initial SET with pod1
+
+	manifest2, _ := ExampleManifestAndPod("2")
+	data2, err := json.Marshal(manifest2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(path, data2, 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	update := waitForUpdate(t, ch)
+	if len(update.Pods) != 1 {
+		t.Fatalf("Expected 1 pod after edit, got %d", len(update.Pods))
+	}
+}
+
+func TestWatchAtomicRenameReplace(t *testing.T) {
+	dirName, err := ioutil.TempDir("", "foo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dirName)
+
+	manifest, _ := ExampleManifestAndPod("1")
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	path := filepath.Join(dirName, "pod1.json")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ch := make(chan interface{}, 2)
+	NewSourceFile(dirName, time.Hour, ch)
+	waitForUpdate(t, ch) // initial SET with pod1
+
+	manifest2, _ := ExampleManifestAndPod("2")
+	data2, err := json.Marshal(manifest2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data2, 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	update := waitForUpdate(t, ch)
+	if len(update.Pods) != 1 {
+		t.Fatalf("Expected 1 pod after atomic replace, got %d", len(update.Pods))
+	}
+}
+
+func TestWatchDeletionProducesEmptySet(t *testing.T) {
+	dirName, err := ioutil.TempDir("", "foo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dirName)
+
+	manifest, _ := ExampleManifestAndPod("1")
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	path := filepath.Join(dirName, "pod1.json")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ch := make(chan interface{}, 2)
+	NewSourceFile(dirName, time.Hour, ch)
+	waitForUpdate(t, ch) // initial SET with pod1
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	update := waitForUpdate(t, ch)
+	if len(update.Pods) != 0 {
+		t.Fatalf("Expected SET with no pods after deletion, got %d", len(update.Pods))
+	}
+}
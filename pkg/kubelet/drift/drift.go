@@ -0,0 +1,234 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package drift compares the pods declared by the kubelet's file/URL config
+// sources against what the kubelet's container runtime actually reports
+// running, and reports the difference as DriftDetected/DriftResolved events.
+package drift
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/types"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+)
+
+// RuntimeState is the subset of a running container's observable state that
+// a Detector compares against a pod's desired spec.
+type RuntimeState struct {
+	Image        string
+	Env          []api.EnvVar
+	Volumes      []api.Volume
+	RestartCount int
+}
+
+// RuntimeLister answers, for a pod UID, what the kubelet's container
+// runtime currently reports running. ok is false if the runtime has no
+// record of the pod yet, in which case it is not considered drifted.
+type RuntimeLister func(uid types.UID) (state RuntimeState, ok bool)
+
+// EventSink receives drift events, mirroring the signature of
+// pkg/client/record's package-level Eventf so production code can wire
+// record.Eventf straight in, while tests supply a fake that records calls.
+type EventSink func(object interface{}, reason, messageFmt string, args ...interface{})
+
+type desiredPod struct {
+	hash string
+	pod  api.BoundPod
+}
+
+// Detector hashes each desired api.BoundPod spec as it's observed from the
+// file/URL sources and, on each reconcile tick, diffs it against the
+// runtime's actual state (ignoring defaulted/status fields via
+// api.Semantic.DeepDerivative), reporting DriftDetected/DriftResolved events
+// through the configured EventSink.
+type Detector struct {
+	emit   EventSink
+	lister RuntimeLister
+
+	lock     sync.Mutex
+	desired  map[types.UID]desiredPod
+	drifted  map[types.UID]bool
+	baseline map[types.UID]int
+}
+
+// NewDetector builds a Detector that reports through emit and reads runtime
+// state from lister.
+func NewDetector(emit EventSink, lister RuntimeLister) *Detector {
+	return &Detector{
+		emit:     emit,
+		lister:   lister,
+		desired:  make(map[types.UID]desiredPod),
+		drifted:  make(map[types.UID]bool),
+		baseline: make(map[types.UID]int),
+	}
+}
+
+// Observe records pod as the latest desired state for its UID. Call this as
+// each PodUpdate is ingested from a file/URL source. A pod whose spec
+// changed since the last Observe is given a chance to match again before
+// being reported drifted a second time.
+func (d *Detector) Observe(pod api.BoundPod) {
+	h := hashSpec(&pod)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if prev, ok := d.desired[pod.UID]; !ok || prev.hash != h {
+		delete(d.drifted, pod.UID)
+	}
+	d.desired[pod.UID] = desiredPod{hash: h, pod: pod}
+}
+
+// Remove forgets uid, e.g. when a SET update no longer declares it.
+func (d *Detector) Remove(uid types.UID) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.desired, uid)
+	delete(d.drifted, uid)
+	delete(d.baseline, uid)
+}
+
+// Accept ingests one update exactly as the file/URL sources emit it: every
+// pod in pods is Observe'd, and if fullSet is true (the caller should pass
+// update.Op == kubelet.SET — the only op those sources ever send) any
+// previously-observed pod missing from pods is Removed. Accept takes plain
+// types rather than kubelet.PodUpdate so this package doesn't import
+// pkg/kubelet, which imports this package for SetupDriftDetection; wire the
+// translation in at the call site next to SetupEventSending.
+func (d *Detector) Accept(pods []api.BoundPod, fullSet bool) {
+	seen := make(map[types.UID]bool, len(pods))
+	for _, pod := range pods {
+		d.Observe(pod)
+		seen[pod.UID] = true
+	}
+
+	if !fullSet {
+		return
+	}
+	d.lock.Lock()
+	var stale []types.UID
+	for uid := range d.desired {
+		if !seen[uid] {
+			stale = append(stale, uid)
+		}
+	}
+	d.lock.Unlock()
+	for _, uid := range stale {
+		d.Remove(uid)
+	}
+}
+
+// Run reconciles every interval until stopCh is closed.
+func (d *Detector) Run(interval time.Duration, stopCh <-chan struct{}) {
+	go util.Until(d.reconcile, interval, stopCh)
+}
+
+func (d *Detector) reconcile() {
+	d.lock.Lock()
+	pods := make([]api.BoundPod, 0, len(d.desired))
+	for _, entry := range d.desired {
+		pods = append(pods, entry.pod)
+	}
+	d.lock.Unlock()
+
+	for _, pod := range pods {
+		d.reconcilePod(pod)
+	}
+}
+
+func (d *Detector) reconcilePod(pod api.BoundPod) {
+	actual, ok := d.lister(pod.UID)
+	if !ok {
+		return
+	}
+
+	want := wantedState(&pod)
+
+	d.lock.Lock()
+	wasDrifted := d.drifted[pod.UID]
+	baseline, hasBaseline := d.baseline[pod.UID]
+	if !hasBaseline {
+		baseline = actual.RestartCount
+		d.baseline[pod.UID] = baseline
+	}
+	d.lock.Unlock()
+
+	specMatches := api.Semantic.DeepDerivative(want, actual)
+	restarted := actual.RestartCount > baseline
+	if specMatches && !restarted {
+		if wasDrifted {
+			d.emit(&pod, "DriftResolved", "Pod %s/%s matches its desired spec again", pod.Namespace, pod.Name)
+			d.lock.Lock()
+			d.drifted[pod.UID] = false
+			// A resolved drift establishes a new baseline: further restarts
+			// are judged against where the pod settled, not where it started.
+			d.baseline[pod.UID] = actual.RestartCount
+			d.lock.Unlock()
+		}
+		return
+	}
+
+	if wasDrifted {
+		// Already reported; don't spam an event every tick while it stays drifted.
+		return
+	}
+
+	d.emit(&pod, "DriftDetected", "Pod %s/%s has drifted from its desired spec: %s",
+		pod.Namespace, pod.Name, diffSummary(want, actual, baseline, restarted))
+	d.lock.Lock()
+	d.drifted[pod.UID] = true
+	d.lock.Unlock()
+}
+
+func wantedState(pod *api.BoundPod) RuntimeState {
+	var want RuntimeState
+	if len(pod.Spec.Containers) > 0 {
+		want.Image = pod.Spec.Containers[0].Image
+		want.Env = pod.Spec.Containers[0].Env
+	}
+	want.Volumes = pod.Spec.Volumes
+	return want
+}
+
+// diffSummary renders a compact, field-level description of how actual
+// differs from want (or has restarted past baseline), for the event
+// message.
+func diffSummary(want, actual RuntimeState, baseline int, restarted bool) string {
+	if want.Image != actual.Image {
+		return fmt.Sprintf("image %q, want %q", actual.Image, want.Image)
+	}
+	if len(want.Env) != len(actual.Env) {
+		return fmt.Sprintf("%d env vars, want %d", len(actual.Env), len(want.Env))
+	}
+	if len(want.Volumes) != len(actual.Volumes) {
+		return fmt.Sprintf("%d volumes, want %d", len(actual.Volumes), len(want.Volumes))
+	}
+	if restarted {
+		return fmt.Sprintf("restart count %d exceeds baseline %d", actual.RestartCount, baseline)
+	}
+	return "runtime state does not match desired spec"
+}
+
+func hashSpec(pod *api.BoundPod) string {
+	hasher := md5.New()
+	util.DeepHashObject(hasher, pod.Spec)
+	return hex.EncodeToString(hasher.Sum(nil))
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drift
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/types"
+)
+
+type fakeRecorder struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (f *fakeRecorder) sink(object interface{}, reason, messageFmt string, args ...interface{}) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.events = append(f.events, reason)
+}
+
+func (f *fakeRecorder) countReason(reason string) int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	count := 0
+	for _, r := range f.events {
+		if r == reason {
+			count++
+		}
+	}
+	return count
+}
+
+func TestDriftDetectedFiresOnceUntilCorrected(t *testing.T) {
+	const uid = types.UID("pod-1")
+	pod := api.BoundPod{
+		ObjectMeta: api.ObjectMeta{Name: "test", Namespace: "default", UID: uid},
+		Spec: api.PodSpec{
+			Containers: []api.Container{{Name: "c1", Image: "app:v1"}},
+		},
+	}
+
+	runtimeImage := "app:v1"
+	lister := func(id types.UID) (RuntimeState, bool) {
+		if id != uid {
+			return RuntimeState{}, false
+		}
+		return RuntimeState{Image: runtimeImage}, true
+	}
+
+	recorder := &fakeRecorder{}
+	detector := NewDetector(recorder.sink, lister)
+	detector.Observe(pod)
+
+	detector.reconcile()
+	if got := recorder.countReason("DriftDetected"); got != 0 {
+		t.Fatalf("Expected no drift while images match, got %d DriftDetected events", got)
+	}
+
+	// Mutate the running container's image out-of-band.
+	runtimeImage = "app:v2"
+
+	detector.reconcile()
+	detector.reconcile()
+	detector.reconcile()
+	if got := recorder.countReason("DriftDetected"); got != 1 {
+		t.Fatalf("Expected exactly 1 DriftDetected event while uncorrected, got %d", got)
+	}
+
+	// Correct the drift.
+	runtimeImage = "app:v1"
+	detector.reconcile()
+	if got := recorder.countReason("DriftResolved"); got != 1 {
+		t.Fatalf("Expected 1 DriftResolved event after correction, got %d", got)
+	}
+
+	// Drift again: should fire a second DriftDetected now that it resolved.
+	runtimeImage = "app:v2"
+	detector.reconcile()
+	if got := recorder.countReason("DriftDetected"); got != 2 {
+		t.Fatalf("Expected a second DriftDetected event after re-drifting, got %d", got)
+	}
+}
+
+func TestDriftDetectedOnRestartCountPastBaseline(t *testing.T) {
+	const uid = types.UID("pod-2")
+	pod := api.BoundPod{
+		ObjectMeta: api.ObjectMeta{Name: "test", Namespace: "default", UID: uid},
+		Spec: api.PodSpec{
+			Containers: []api.Container{{Name: "c1", Image: "app:v1"}},
+		},
+	}
+
+	restartCount := 0
+	lister := func(id types.UID) (RuntimeState, bool) {
+		if id != uid {
+			return RuntimeState{}, false
+		}
+		return RuntimeState{Image: "app:v1", RestartCount: restartCount}, true
+	}
+
+	recorder := &fakeRecorder{}
+	detector := NewDetector(recorder.sink, lister)
+	detector.Observe(pod)
+
+	// First tick establishes the baseline at the current restart count; it
+	// must not itself be reported as drift.
+	detector.reconcile()
+	if got := recorder.countReason("DriftDetected"); got != 0 {
+		t.Fatalf("Expected baseline tick to report no drift, got %d DriftDetected events", got)
+	}
+
+	// The container crash-loops past its baseline.
+	restartCount = 3
+	detector.reconcile()
+	detector.reconcile()
+	if got := recorder.countReason("DriftDetected"); got != 1 {
+		t.Fatalf("Expected exactly 1 DriftDetected event for restarts past baseline, got %d", got)
+	}
+
+	// Staying at the same restart count should not fire again.
+	detector.reconcile()
+	if got := recorder.countReason("DriftDetected"); got != 1 {
+		t.Fatalf("Expected no additional DriftDetected events while restart count is steady, got %d", got)
+	}
+}
@@ -17,9 +17,12 @@ limitations under the License.
 package kubelet
 
 import (
+	"time"
+
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/capabilities"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/client/record"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet/drift"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/tools"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
 	"github.com/coreos/go-etcd/etcd"
@@ -58,3 +61,15 @@ func SetupEventSending(client *client.Client, hostname string) {
 	glog.Infof("Sending events to api server.")
 	record.StartRecording(client.Events(""))
 }
+
+// SetupDriftDetection starts a drift.Detector comparing the pods declared by
+// the file/URL config sources against lister's view of the container
+// runtime, reporting DriftDetected/DriftResolved events through
+// pkg/client/record. Pass the --drift-detect-interval flag value as
+// interval; the returned Detector's Accept method should be called with each
+// PodUpdate the kubelet ingests from its config sources.
+func SetupDriftDetection(lister drift.RuntimeLister, interval time.Duration, stopCh <-chan struct{}) *drift.Detector {
+	detector := drift.NewDetector(record.Eventf, lister)
+	detector.Run(interval, stopCh)
+	return detector
+}